@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/Code-Hex/m1-docker/internal/cloudinit"
+	"github.com/Code-Hex/m1-docker/internal/machine"
+	"github.com/pkg/errors"
+)
+
+// buildCloudInitSeed renders cfg into a NoCloud #cloud-config and
+// writes the resulting seed ISO to the machine's seed.iso. SSH keys
+// fall back to the user's own ~/.ssh/id_*.pub when none were recorded
+// on the machine.
+func buildCloudInitSeed(cfg *machine.Config) error {
+	seedPath, err := machine.SeedImgPath(cfg.Name)
+	if err != nil {
+		return err
+	}
+
+	keys := cfg.SSHAuthorizedKeys
+	if len(keys) == 0 {
+		defaults, err := cloudinit.DefaultSSHAuthorizedKeys()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		keys = defaults
+	}
+
+	return cloudinit.WriteSeedISO(cloudinit.Config{
+		Hostname:          cfg.Hostname,
+		User:              cfg.User,
+		Password:          cfg.Password,
+		SSHAuthorizedKeys: keys,
+		RunCmd:            cfg.RunCmd,
+	}, seedPath)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/Code-Hex/m1-docker/internal/image2rootfs"
+	"github.com/Code-Hex/m1-docker/internal/machine"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// initCommand implements `m1-docker init <name>`: it creates the named
+// machine's directory, records its configuration, and fetches/builds
+// the kernel, initrd, rootfs, and cloud-init seed it needs to boot.
+type initCommand struct {
+	Image            string   `long:"image" description:"OCI image reference to boot instead of the default Ubuntu cloud image, e.g. docker.io/library/alpine:3.19"`
+	CPUs             int      `long:"cpus" default:"2" description:"number of vCPUs"`
+	MemoryGB         int      `long:"memory" default:"2" description:"memory size in GB"`
+	DiskGB           int      `long:"disk" default:"20" description:"disk image size in GB"`
+	CommandLine      string   `long:"command" default:"console=hvc0" description:"kernel command line"`
+	Hostname         string   `long:"hostname" description:"hostname to seed into the guest; defaults to the machine name"`
+	User             string   `long:"user" default:"m1docker" description:"login user to seed into the guest via cloud-init"`
+	Password         string   `long:"password" description:"password for --user; leave empty to rely on SSH keys only"`
+	SSHAuthorizedKey []string `long:"ssh-authorized-key" description:"public key to seed into the guest's authorized_keys (repeatable); defaults to ~/.ssh/id_*.pub"`
+	RunCmd           []string `long:"run-cmd" description:"command to run on first boot (repeatable)"`
+	DockerVsockPort  uint32   `long:"docker-vsock-port" default:"2375" description:"vsock port the guest's dockerd is expected to listen on"`
+
+	Args struct {
+		Name string `positional-arg-name:"name"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *initCommand) Execute(args []string) error {
+	name := c.Args.Name
+
+	if exists, err := machine.Exists(name); err != nil {
+		return err
+	} else if exists {
+		return errors.Errorf("machine %q already exists", name)
+	}
+
+	hostname := c.Hostname
+	if hostname == "" {
+		hostname = name
+	}
+
+	cfg := &machine.Config{
+		Name:              name,
+		Image:             c.Image,
+		CPUs:              c.CPUs,
+		MemoryMB:          c.MemoryGB * 1024,
+		DiskMB:            c.DiskGB * 1024,
+		CommandLine:       c.CommandLine,
+		Hostname:          hostname,
+		User:              c.User,
+		Password:          c.Password,
+		SSHAuthorizedKeys: c.SSHAuthorizedKey,
+		RunCmd:            c.RunCmd,
+		DockerVsockPort:   c.DockerVsockPort,
+	}
+
+	if _, err := machine.Dir(name); err != nil {
+		return err
+	}
+	if err := machine.Save(cfg); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := fetchMachineAssets(ctx, cfg); err != nil {
+		return err
+	}
+	if err := buildCloudInitSeed(cfg); err != nil {
+		return errors.WithStack(err)
+	}
+
+	log.Printf("machine %q initialized", name)
+	return nil
+}
+
+// fetchMachineAssets populates cfg's machine directory with a kernel,
+// initrd, and rootfs: converted from cfg.Image when set, or the
+// project's default downloaded Ubuntu cloud image otherwise.
+func fetchMachineAssets(ctx context.Context, cfg *machine.Config) error {
+	kernelPath, err := machine.KernelPath(cfg.Name)
+	if err != nil {
+		return err
+	}
+	initrdPath, err := machine.InitrdPath(cfg.Name)
+	if err != nil {
+		return err
+	}
+	diskImgPath, err := machine.DiskImgPath(cfg.Name)
+	if err != nil {
+		return err
+	}
+
+	kernel := image2rootfs.KernelSelection{}
+	if cfg.Image != "" {
+		log.Println("converting image to rootfs...", cfg.Image)
+		selected, err := image2rootfs.Convert(ctx, image2rootfs.Options{
+			Ref:     cfg.Image,
+			DiskImg: diskImgPath,
+			SizeMB:  cfg.DiskMB,
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		kernel = selected
+		log.Println("done converting image to rootfs")
+	} else {
+		log.Println("fetching default disk image...")
+		if err := fetchDefaultDiskImg(ctx, diskImgPath, cfg.DiskMB); err != nil {
+			return errors.WithStack(err)
+		}
+		log.Println("done fetching default disk image")
+	}
+
+	if kernel.Found {
+		if kernel.Cleanup != nil {
+			defer kernel.Cleanup()
+		}
+		if err := copyFile(kernel.KernelPath, kernelPath); err != nil {
+			return err
+		}
+		if err := copyFile(kernel.InitrdPath, initrdPath); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.Go(func() error {
+		log.Println("fetching default vmlinuz...")
+		defer log.Println("done fetching default vmlinuz")
+		return fetchDefaultVmlinuz(egCtx, kernelPath)
+	})
+	eg.Go(func() error {
+		log.Println("fetching default initrd...")
+		defer log.Println("done fetching default initrd")
+		return fetchDefaultInitrd(egCtx, initrdPath)
+	})
+	return eg.Wait()
+}
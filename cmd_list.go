@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Code-Hex/m1-docker/internal/machine"
+)
+
+// listCommand implements `m1-docker list`: it prints every initialized
+// machine, its configured resources, and whether it's currently
+// running.
+type listCommand struct{}
+
+func (c *listCommand) Execute(args []string) error {
+	names, err := machine.List()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tIMAGE\tCPUS\tMEMORY\tSTATE")
+	for _, name := range names {
+		cfg, err := machine.Load(name)
+		if err != nil {
+			return err
+		}
+
+		state := "stopped"
+		if pid, err := machine.ReadPid(name); err != nil {
+			return err
+		} else if pid != 0 && processAlive(pid) {
+			state = "running"
+		}
+
+		image := cfg.Image
+		if image == "" {
+			image = "(default ubuntu)"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%dMB\t%s\n", cfg.Name, image, cfg.CPUs, cfg.MemoryMB, state)
+	}
+	return w.Flush()
+}
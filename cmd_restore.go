@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/Code-Hex/m1-docker/internal/machine"
+	"github.com/Code-Hex/m1-docker/internal/snapshot"
+	"github.com/pkg/errors"
+)
+
+// restoreCommand implements `m1-docker restore <name> <snapshot>`: it
+// reconstructs the machine's config and disk image from a snapshot
+// taken with `save`, so `start` cold-boots the preserved disk state
+// instead of the machine's current one.
+type restoreCommand struct {
+	Args struct {
+		Name     string `positional-arg-name:"name"`
+		Snapshot string `positional-arg-name:"snapshot"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *restoreCommand) Execute(args []string) error {
+	name, snapshotName := c.Args.Name, c.Args.Snapshot
+
+	if pid, err := machine.ReadPid(name); err != nil {
+		return err
+	} else if pid != 0 && processAlive(pid) {
+		return errors.Errorf("machine %q is running; stop it before restoring a snapshot", name)
+	}
+
+	snapConfigPath, err := machine.SnapshotConfigPath(name, snapshotName)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(snapConfigPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.Errorf("machine %q has no snapshot %q", name, snapshotName)
+		}
+		return errors.WithStack(err)
+	}
+	var cfg machine.Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return errors.Wrapf(err, "parsing snapshot config for %q/%q", name, snapshotName)
+	}
+	if err := machine.Save(&cfg); err != nil {
+		return err
+	}
+
+	snapDiskPath, err := machine.SnapshotDiskPath(name, snapshotName)
+	if err != nil {
+		return err
+	}
+	diskImgPath, err := machine.DiskImgPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(diskImgPath); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := snapshot.CloneFile(snapDiskPath, diskImgPath); err != nil {
+		return err
+	}
+
+	log.Printf("machine %q restored from snapshot %q; run `m1-docker start %s`", name, snapshotName, name)
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log"
+
+	"github.com/Code-Hex/m1-docker/internal/machine"
+	"github.com/pkg/errors"
+)
+
+// rmCommand implements `m1-docker rm <name>`: it deletes a machine's
+// entire directory. Stop the machine first; rm refuses to remove a
+// running one.
+type rmCommand struct {
+	Args struct {
+		Name string `positional-arg-name:"name"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *rmCommand) Execute(args []string) error {
+	name := c.Args.Name
+
+	if pid, err := machine.ReadPid(name); err != nil {
+		return err
+	} else if pid != 0 && processAlive(pid) {
+		return errors.Errorf("machine %q is running (pid %d); stop it first", name, pid)
+	}
+
+	if err := machine.Remove(name); err != nil {
+		return err
+	}
+	log.Printf("machine %q removed", name)
+	return nil
+}
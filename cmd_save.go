@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/Code-Hex/m1-docker/internal/machine"
+	"github.com/Code-Hex/m1-docker/internal/snapshot"
+	"github.com/pkg/errors"
+)
+
+// saveCommand implements `m1-docker save <name> <snapshot>`: it
+// clones the machine's disk image and config into
+// snapshots/<snapshot>/ so `restore` can bring that disk state back.
+// No guest memory state is saved: a restored machine cold-boots from
+// the cloned disk.
+//
+// --memory-only is accepted but not yet implemented: suspending a
+// running VM's vCPUs in place requires the `start` daemon to expose a
+// pause/resume control channel, which doesn't exist yet. Today `save`
+// only works on a stopped machine.
+type saveCommand struct {
+	MemoryOnly bool `long:"memory-only" description:"fast-suspend the VM in place instead of a full disk snapshot (not yet implemented)"`
+
+	Args struct {
+		Name     string `positional-arg-name:"name"`
+		Snapshot string `positional-arg-name:"snapshot"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *saveCommand) Execute(args []string) error {
+	name, snapshotName := c.Args.Name, c.Args.Snapshot
+
+	if c.MemoryOnly {
+		return errors.New("--memory-only isn't implemented yet: the start daemon has no pause/resume control channel")
+	}
+
+	if pid, err := machine.ReadPid(name); err != nil {
+		return err
+	} else if pid != 0 && processAlive(pid) {
+		return errors.Errorf("machine %q is running; stop it before saving a snapshot", name)
+	}
+
+	cfg, err := machine.Load(name)
+	if err != nil {
+		return err
+	}
+
+	diskImgPath, err := machine.DiskImgPath(name)
+	if err != nil {
+		return err
+	}
+	snapDiskPath, err := machine.SnapshotDiskPath(name, snapshotName)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(snapDiskPath); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := snapshot.CloneFile(diskImgPath, snapDiskPath); err != nil {
+		return err
+	}
+
+	snapConfigPath, err := machine.SnapshotConfigPath(name, snapshotName)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.WriteFile(snapConfigPath, data, 0o644); err != nil {
+		return errors.WithStack(err)
+	}
+
+	log.Printf("machine %q saved as snapshot %q", name, snapshotName)
+	return nil
+}
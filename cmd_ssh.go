@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/Code-Hex/m1-docker/internal/machine"
+	"github.com/pkg/errors"
+)
+
+// sshCommand implements `m1-docker ssh <name>`: it execs the system
+// ssh client against the vsock-forwarded port the running machine
+// recorded in ssh.port.
+type sshCommand struct {
+	Args struct {
+		Name string `positional-arg-name:"name"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *sshCommand) Execute(args []string) error {
+	name := c.Args.Name
+	cfg, err := machine.Load(name)
+	if err != nil {
+		return err
+	}
+
+	if pid, err := machine.ReadPid(name); err != nil {
+		return err
+	} else if pid == 0 || !processAlive(pid) {
+		return errors.Errorf("machine %q is not running", name)
+	}
+
+	portPath, err := machine.SSHPortPath(name)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(portPath)
+	if err != nil {
+		return errors.Wrapf(err, "reading ssh port for machine %q; is it still starting up?", name)
+	}
+	port, err := strconv.Atoi(string(data))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	cmd := exec.Command("ssh",
+		"-p", strconv.Itoa(port),
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		cfg.User+"@127.0.0.1",
+	)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
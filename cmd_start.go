@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/Code-Hex/m1-docker/internal/machine"
+	"github.com/pkg/errors"
+)
+
+// daemonizeEnv is set on the forked child so startCommand.Execute knows
+// it's already running detached and should boot the VM in the
+// foreground of its own process instead of forking again.
+const daemonizeEnv = "M1DOCKER_DAEMONIZE"
+
+// startCommand implements `m1-docker start <name>`: it daemonizes into
+// a detached child that keeps the VM alive, writes a pidfile, and
+// streams the serial console to the machine's console.log.
+type startCommand struct {
+	Foreground bool `long:"foreground" description:"run in the foreground instead of daemonizing"`
+
+	Args struct {
+		Name string `positional-arg-name:"name"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *startCommand) Execute(args []string) error {
+	name := c.Args.Name
+	cfg, err := machine.Load(name)
+	if err != nil {
+		return err
+	}
+
+	if pid, err := machine.ReadPid(name); err != nil {
+		return err
+	} else if pid != 0 && pid != os.Getpid() && processAlive(pid) {
+		// The daemonized child finds its own pid here, written by
+		// daemonize right after forking it.
+		return errors.Errorf("machine %q is already running (pid %d)", name, pid)
+	}
+
+	if c.Foreground || os.Getenv(daemonizeEnv) == "1" {
+		return runVM(context.Background(), cfg)
+	}
+
+	return daemonize(name)
+}
+
+// daemonize re-execs the current binary as `start --foreground <name>`
+// with stdio redirected to the machine's console.log, detaches it from
+// the controlling terminal, and records its pid.
+func daemonize(name string) error {
+	logPath, err := machine.LogPath(name)
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer logFile.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	cmd := exec.Command(exe, "start", "--foreground", name)
+	cmd.Env = append(os.Environ(), daemonizeEnv+"=1")
+	cmd.Stdin = nil
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "forking daemonized VM process")
+	}
+	if err := machine.WritePid(name, cmd.Process.Pid); err != nil {
+		return err
+	}
+
+	log.Printf("machine %q started (pid %d), console log at %s", name, cmd.Process.Pid, logPath)
+	return nil
+}
+
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/Code-Hex/m1-docker/internal/machine"
+	"github.com/pkg/errors"
+)
+
+// stopCommand implements `m1-docker stop <name>`: it signals the
+// daemonized VM process to shut down and waits for it to exit.
+type stopCommand struct {
+	Args struct {
+		Name string `positional-arg-name:"name"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func (c *stopCommand) Execute(args []string) error {
+	name := c.Args.Name
+	pid, err := machine.ReadPid(name)
+	if err != nil {
+		return err
+	}
+	if pid == 0 || !processAlive(pid) {
+		log.Printf("machine %q is not running", name)
+		return machine.RemovePid(name)
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := process.Signal(syscall.SIGINT); err != nil {
+		return errors.Wrapf(err, "signaling machine %q (pid %d)", name, pid)
+	}
+
+	for i := 0; i < 50; i++ {
+		if !processAlive(pid) {
+			log.Printf("machine %q stopped", name)
+			return machine.RemovePid(name)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return errors.Errorf("machine %q (pid %d) did not stop in time", name, pid)
+}
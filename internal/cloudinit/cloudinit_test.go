@@ -0,0 +1,117 @@
+package cloudinit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMetaData(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{
+			name: "explicit hostname",
+			cfg:  Config{Hostname: "web-1"},
+			want: "instance-id: web-1\nlocal-hostname: web-1\n",
+		},
+		{
+			name: "defaults when hostname is empty",
+			cfg:  Config{},
+			want: "instance-id: m1-docker\nlocal-hostname: m1-docker\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderMetaData(tt.cfg); got != tt.want {
+				t.Errorf("renderMetaData(%+v) = %q, want %q", tt.cfg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderUserData(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		contains []string
+		omits    []string
+	}{
+		{
+			name:     "defaults",
+			cfg:      Config{},
+			contains: []string{"#cloud-config\n", `hostname: "m1-docker"` + "\n", `- name: "m1docker"` + "\n"},
+			omits:    []string{"ssh_authorized_keys:", "chpasswd:", "runcmd:"},
+		},
+		{
+			name: "full config",
+			cfg: Config{
+				Hostname:          "web-1",
+				User:              "alice",
+				Password:          "hunter2",
+				SSHAuthorizedKeys: []string{"ssh-ed25519 AAAA... a@b"},
+				RunCmd:            []string{"echo hi"},
+			},
+			contains: []string{
+				`hostname: "web-1"` + "\n",
+				`- name: "alice"` + "\n",
+				`ssh_authorized_keys:` + "\n      " + `- "ssh-ed25519 AAAA... a@b"` + "\n",
+				"chpasswd:\n  list: |\n    alice:hunter2\n  expire: false\n",
+				`runcmd:` + "\n  " + `- "echo hi"` + "\n",
+			},
+		},
+		{
+			name:  "no ssh keys or run commands",
+			cfg:   Config{SSHAuthorizedKeys: nil, RunCmd: nil},
+			omits: []string{"ssh_authorized_keys:", "runcmd:"},
+		},
+		{
+			name: "run-cmd containing a YAML comment marker isn't truncated",
+			cfg:  Config{RunCmd: []string{`echo hi # done`}},
+			contains: []string{
+				`- "echo hi # done"` + "\n",
+			},
+			omits: []string{
+				// the old bare-scalar rendering, which YAML would
+				// truncate at " #", dropping everything after it
+				"- echo hi\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderUserData(tt.cfg)
+			for _, s := range tt.contains {
+				if !strings.Contains(got, s) {
+					t.Errorf("renderUserData(%+v) missing %q, got:\n%s", tt.cfg, s, got)
+				}
+			}
+			for _, s := range tt.omits {
+				if strings.Contains(got, s) {
+					t.Errorf("renderUserData(%+v) unexpectedly contains %q, got:\n%s", tt.cfg, s, got)
+				}
+			}
+		})
+	}
+}
+
+func TestYAMLQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "alice", want: `"alice"`},
+		{name: "contains double quote", in: `say "hi"`, want: `"say \"hi\""`},
+		{name: "contains comment marker", in: "echo hi # done", want: `"echo hi # done"`},
+		{name: "contains backslash", in: `C:\path`, want: `"C:\\path"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := yamlQuote(tt.in); got != tt.want {
+				t.Errorf("yamlQuote(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package cloudinit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultSSHAuthorizedKeys returns the contents of the user's default
+// public keys (~/.ssh/id_*.pub) for use when no --ssh-authorized-key
+// flag was given. Keys that fail to read are skipped rather than
+// failing the whole VM setup.
+func DefaultSSHAuthorizedKeys() ([]string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(home, ".ssh", "id_*.pub"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var keys []string
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if key := strings.TrimSpace(string(data)); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,59 @@
+package image2rootfs
+
+import (
+	"fmt"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const fstab = `# generated by m1-docker image2rootfs
+/dev/vda / ext4 defaults 0 1
+`
+
+const resolvConf = `nameserver 1.1.1.1
+nameserver 8.8.8.8
+`
+
+// writeGuestConfig writes the handful of /etc files a minimal guest
+// needs to boot and get network access: fstab, hostname, resolv.conf.
+func writeGuestConfig(staging string, _ ocispec.ImageConfig) error {
+	if err := writeFile(stagingPath(staging, "etc", "fstab"), fstab, 0o644); err != nil {
+		return err
+	}
+	if err := writeFile(stagingPath(staging, "etc", "hostname"), "m1-docker\n", 0o644); err != nil {
+		return err
+	}
+	if err := writeFile(stagingPath(staging, "etc", "resolv.conf"), resolvConf, 0o644); err != nil {
+		return err
+	}
+	return nil
+}
+
+// writeEntrypoint renders an init script that execs the image's
+// Entrypoint+Cmd as PID 1. It's intentionally minimal: no service
+// manager, just enough to run the container's process under the kernel
+// console so `m1-docker` boots straight into the image's own workload.
+func writeEntrypoint(staging string, config ocispec.ImageConfig) error {
+	argv := append(append([]string{}, config.Entrypoint...), config.Cmd...)
+	if len(argv) == 0 {
+		argv = []string{"/bin/sh"}
+	}
+
+	var quoted []string
+	for _, a := range argv {
+		quoted = append(quoted, fmt.Sprintf("%q", a))
+	}
+
+	script := fmt.Sprintf(`#!/bin/sh
+# generated by m1-docker image2rootfs: execs the image's own
+# Entrypoint+Cmd as the guest init process.
+export PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin
+mount -t proc proc /proc
+mount -t sysfs sysfs /sys
+mount -t devtmpfs devtmpfs /dev
+exec %s
+`, strings.Join(quoted, " "))
+
+	return writeFile(stagingPath(staging, "sbin", "init"), script, 0o755)
+}
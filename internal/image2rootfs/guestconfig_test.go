@@ -0,0 +1,77 @@
+package image2rootfs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestWriteEntrypoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ocispec.ImageConfig
+		want   string // exec line, after "exec "
+	}{
+		{
+			name:   "no entrypoint or cmd falls back to a shell",
+			config: ocispec.ImageConfig{},
+			want:   `"/bin/sh"`,
+		},
+		{
+			name:   "cmd only",
+			config: ocispec.ImageConfig{Cmd: []string{"nginx", "-g", "daemon off;"}},
+			want:   `"nginx" "-g" "daemon off;"`,
+		},
+		{
+			name:   "entrypoint only",
+			config: ocispec.ImageConfig{Entrypoint: []string{"/entrypoint.sh"}},
+			want:   `"/entrypoint.sh"`,
+		},
+		{
+			name: "entrypoint and cmd are concatenated",
+			config: ocispec.ImageConfig{
+				Entrypoint: []string{"/usr/bin/dumb-init", "--"},
+				Cmd:        []string{"myapp", "--flag"},
+			},
+			want: `"/usr/bin/dumb-init" "--" "myapp" "--flag"`,
+		},
+		{
+			name:   "argv entries are quoted so spaces can't split into extra args",
+			config: ocispec.ImageConfig{Cmd: []string{"sh", "-c", "echo hello world"}},
+			want:   `"sh" "-c" "echo hello world"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			staging := t.TempDir()
+			if err := writeEntrypoint(staging, tt.config); err != nil {
+				t.Fatalf("writeEntrypoint: %v", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(staging, "sbin", "init"))
+			if err != nil {
+				t.Fatalf("reading generated init script: %v", err)
+			}
+			script := string(data)
+
+			if !strings.HasPrefix(script, "#!/bin/sh\n") {
+				t.Errorf("generated init script missing shebang, got:\n%s", script)
+			}
+			wantLine := "exec " + tt.want + "\n"
+			if !strings.Contains(script, wantLine) {
+				t.Errorf("generated init script missing %q, got:\n%s", wantLine, script)
+			}
+
+			info, err := os.Stat(filepath.Join(staging, "sbin", "init"))
+			if err != nil {
+				t.Fatalf("stat generated init script: %v", err)
+			}
+			if info.Mode().Perm() != 0o755 {
+				t.Errorf("generated init script mode = %v, want 0755", info.Mode().Perm())
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+// Package image2rootfs turns an OCI image reference into a bootable VM
+// rootfs: pull the image, unpack its layers into a staging directory,
+// synthesize the handful of files a guest needs to come up (fstab,
+// hostname, resolv.conf, an init entrypoint derived from the image
+// config), and flatten the result into a raw ext4 disk image.
+package image2rootfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Options controls how an OCI image is converted into a VM disk image.
+type Options struct {
+	// Ref is the OCI image reference, e.g. "docker.io/library/alpine:3.19".
+	Ref string
+	// DiskImg is the path of the raw ext4 image to produce.
+	DiskImg string
+	// SizeMB is the size of the produced disk image in megabytes.
+	SizeMB int
+	// StagingDir is used to unpack layers before they're flattened into
+	// DiskImg. A temp directory is used when empty.
+	StagingDir string
+}
+
+// Convert pulls Ref, unpacks it into a staging directory and writes a raw
+// ext4 disk image at Options.DiskImg. It returns the selected kernel and
+// initrd paths so the caller can decide whether to boot them instead of
+// the default downloaded ones.
+func Convert(ctx context.Context, opts Options) (KernelSelection, error) {
+	staging := opts.StagingDir
+	if staging == "" {
+		dir, err := os.MkdirTemp("", "m1-docker-rootfs-")
+		if err != nil {
+			return KernelSelection{}, errors.WithStack(err)
+		}
+		// selectKernel below may return paths inside dir; persistKernelSelection
+		// copies them out to standalone temp files before dir is removed here.
+		defer os.RemoveAll(dir)
+		staging = dir
+	}
+
+	img, err := pullImage(ctx, opts.Ref)
+	if err != nil {
+		return KernelSelection{}, errors.Wrapf(err, "pulling %s", opts.Ref)
+	}
+	// BlobDir (set by the containers/image fallback in pull_fallback.go)
+	// holds a full on-disk copy of the image's layers; it's only needed
+	// until unpackLayers has read them below.
+	if img.BlobDir != "" {
+		defer os.RemoveAll(img.BlobDir)
+	}
+
+	if err := unpackLayers(staging, img); err != nil {
+		return KernelSelection{}, errors.Wrapf(err, "unpacking %s", opts.Ref)
+	}
+
+	if err := writeGuestConfig(staging, img.Config); err != nil {
+		return KernelSelection{}, errors.Wrap(err, "writing guest config")
+	}
+
+	if err := writeEntrypoint(staging, img.Config); err != nil {
+		return KernelSelection{}, errors.Wrap(err, "writing init entrypoint")
+	}
+
+	kernel, err := selectKernel(staging)
+	if err != nil {
+		return KernelSelection{}, errors.Wrap(err, "selecting kernel")
+	}
+
+	if err := buildExt4(staging, opts.DiskImg, opts.SizeMB); err != nil {
+		return KernelSelection{}, errors.Wrapf(err, "building %s", opts.DiskImg)
+	}
+
+	if kernel.Found {
+		kernel, err = persistKernelSelection(kernel)
+		if err != nil {
+			return KernelSelection{}, errors.Wrap(err, "persisting selected kernel")
+		}
+	}
+
+	return kernel, nil
+}
+
+// persistKernelSelection copies a kernel/initrd selected from a staging
+// directory into standalone temp files so they remain readable after
+// Convert's staging directory is removed; the caller (fetchMachineAssets)
+// copies them into the machine directory and should then call the
+// returned Cleanup to remove these temp files.
+func persistKernelSelection(kernel KernelSelection) (KernelSelection, error) {
+	vmlinuz, err := copyToTempFile(kernel.KernelPath, "m1-docker-vmlinuz-")
+	if err != nil {
+		return KernelSelection{}, err
+	}
+	initrd, err := copyToTempFile(kernel.InitrdPath, "m1-docker-initrd-")
+	if err != nil {
+		os.Remove(vmlinuz)
+		return KernelSelection{}, err
+	}
+	return KernelSelection{
+		Found:      true,
+		KernelPath: vmlinuz,
+		InitrdPath: initrd,
+		Cleanup: func() {
+			os.Remove(vmlinuz)
+			os.Remove(initrd)
+		},
+	}, nil
+}
+
+func copyToTempFile(src, pattern string) (string, error) {
+	dst, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer dst.Close()
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer in.Close()
+
+	if _, err := io.Copy(dst, in); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return dst.Name(), nil
+}
+
+// buildExt4 flattens staging into a raw ext4 image of the given size.
+// It shells out to mkfs.ext4, which is ubiquitous on Linux hosts; a
+// pure-Go tar->ext4 writer would avoid the dependency but isn't
+// implemented yet.
+func buildExt4(staging, dest string, sizeMB int) error {
+	if sizeMB <= 0 {
+		return errors.Errorf("invalid disk image size: %d", sizeMB)
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := f.Truncate(int64(sizeMB) * 1024 * 1024); err != nil {
+		f.Close()
+		return errors.WithStack(err)
+	}
+	if err := f.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return runMkfsExt4(dest, staging)
+}
+
+func stagingPath(staging string, elems ...string) string {
+	return filepath.Join(append([]string{staging}, elems...)...)
+}
+
+func ensureDir(path string) error {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func writeFile(path string, content string, mode os.FileMode) error {
+	if err := ensureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// String implements fmt.Stringer for debugging/log output.
+func (o Options) String() string {
+	return fmt.Sprintf("image2rootfs.Options{Ref:%s DiskImg:%s SizeMB:%d}", o.Ref, o.DiskImg, o.SizeMB)
+}
@@ -0,0 +1,58 @@
+package image2rootfs
+
+import (
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// KernelSelection describes which kernel/initrd pair to boot. Found is
+// false when the image didn't ship its own and the caller should fall
+// back to the downloaded Ubuntu vmlinuz/initrd. Cleanup removes any
+// backing temp files once the caller is done reading KernelPath/
+// InitrdPath; it's nil when Found is false.
+type KernelSelection struct {
+	Found      bool
+	KernelPath string
+	InitrdPath string
+	Cleanup    func()
+}
+
+// selectKernel looks for /boot/vmlinuz* and /boot/initrd* in the
+// unpacked image. Most minimal images (alpine, distroless, ...) don't
+// ship a kernel at all, in which case the caller boots the project's
+// own downloaded vmlinuz/initrd against the image's rootfs.
+func selectKernel(staging string) (KernelSelection, error) {
+	vmlinuz, err := globOne(staging, "boot", "vmlinuz*")
+	if err != nil {
+		return KernelSelection{}, err
+	}
+	if vmlinuz == "" {
+		return KernelSelection{}, nil
+	}
+
+	initrd, err := globOne(staging, "boot", "initrd*")
+	if err != nil {
+		return KernelSelection{}, err
+	}
+	if initrd == "" {
+		return KernelSelection{}, nil
+	}
+
+	return KernelSelection{
+		Found:      true,
+		KernelPath: vmlinuz,
+		InitrdPath: initrd,
+	}, nil
+}
+
+func globOne(staging string, elems ...string) (string, error) {
+	matches, err := filepath.Glob(stagingPath(staging, elems...))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if len(matches) == 0 {
+		return "", nil
+	}
+	return matches[0], nil
+}
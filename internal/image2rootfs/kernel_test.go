@@ -0,0 +1,71 @@
+package image2rootfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelectKernel(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      []string // paths relative to staging, created empty
+		wantFound  bool
+		wantKernel string // relative to staging; checked only if wantFound
+		wantInitrd string // relative to staging; checked only if wantFound
+	}{
+		{
+			name:      "no boot directory",
+			files:     nil,
+			wantFound: false,
+		},
+		{
+			name:      "vmlinuz without initrd",
+			files:     []string{"boot/vmlinuz-5.15.0"},
+			wantFound: false,
+		},
+		{
+			name:      "initrd without vmlinuz",
+			files:     []string{"boot/initrd.img-5.15.0"},
+			wantFound: false,
+		},
+		{
+			name:       "both present",
+			files:      []string{"boot/vmlinuz-5.15.0", "boot/initrd.img-5.15.0"},
+			wantFound:  true,
+			wantKernel: "boot/vmlinuz-5.15.0",
+			wantInitrd: "boot/initrd.img-5.15.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			staging := t.TempDir()
+			for _, f := range tt.files {
+				full := filepath.Join(staging, f)
+				if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+					t.Fatalf("MkdirAll: %v", err)
+				}
+				if err := os.WriteFile(full, nil, 0o644); err != nil {
+					t.Fatalf("WriteFile: %v", err)
+				}
+			}
+
+			got, err := selectKernel(staging)
+			if err != nil {
+				t.Fatalf("selectKernel: %v", err)
+			}
+			if got.Found != tt.wantFound {
+				t.Fatalf("selectKernel(%v).Found = %v, want %v", tt.files, got.Found, tt.wantFound)
+			}
+			if !tt.wantFound {
+				return
+			}
+			if got.KernelPath != filepath.Join(staging, tt.wantKernel) {
+				t.Errorf("KernelPath = %q, want %q", got.KernelPath, filepath.Join(staging, tt.wantKernel))
+			}
+			if got.InitrdPath != filepath.Join(staging, tt.wantInitrd) {
+				t.Errorf("InitrdPath = %q, want %q", got.InitrdPath, filepath.Join(staging, tt.wantInitrd))
+			}
+		})
+	}
+}
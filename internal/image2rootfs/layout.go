@@ -0,0 +1,44 @@
+package image2rootfs
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// indexPath returns the path of an OCI layout's top-level index.json.
+func indexPath(layoutDir string) string {
+	return filepath.Join(layoutDir, "index.json")
+}
+
+// blobPath returns the content-addressed path of a blob inside an OCI
+// layout directory, e.g. blobs/sha256/<hex digest>.
+func blobPath(layoutDir string, desc ocispec.Descriptor) string {
+	return filepath.Join(layoutDir, "blobs", desc.Digest.Algorithm().String(), desc.Digest.Encoded())
+}
+
+// readLayoutBlob reads and JSON-decodes the file at path into T.
+func readLayoutBlob[T any](path string) (T, error) {
+	var out T
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return out, errors.Wrapf(err, "reading %s", path)
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return out, errors.Wrapf(err, "decoding %s", path)
+	}
+	return out, nil
+}
+
+// readBlobFile reads a raw (non-JSON) blob from an OCI layout
+// directory, used to stream layer tarballs during unpack.
+func readBlobFile(layoutDir string, desc ocispec.Descriptor) (*os.File, error) {
+	f, err := os.Open(blobPath(layoutDir, desc))
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening layer blob %s", desc.Digest)
+	}
+	return f, nil
+}
@@ -0,0 +1,20 @@
+package image2rootfs
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// runMkfsExt4 formats img as ext4 and seeds it with the contents of
+// staging in one pass via mkfs.ext4's -d flag. A pure-Go tar->ext4
+// writer would avoid the external dependency but isn't implemented yet;
+// mkfs.ext4 is available on effectively every Linux host.
+func runMkfsExt4(img, staging string) error {
+	cmd := exec.Command("mkfs.ext4", "-q", "-d", staging, img)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "mkfs.ext4: %s", out)
+	}
+	return nil
+}
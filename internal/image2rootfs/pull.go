@@ -0,0 +1,64 @@
+package image2rootfs
+
+import (
+	"context"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// defaultNamespace is the containerd namespace m1-docker pulls into, kept
+// separate from the "default" namespace containerd/ctr normally use.
+const defaultNamespace = "m1-docker"
+
+// defaultSocket is where we expect a containerd daemon to be listening.
+// When it isn't reachable, pullImage falls back to containers/image.
+const defaultSocket = "/run/containerd/containerd.sock"
+
+// image is the pulled OCI image: its layers in application order and its
+// decoded image config (entrypoint, cmd, env, ...). BlobDir is empty
+// when the layers live in the local containerd content store; when
+// pulled via the containers/image fallback, BlobDir points at the
+// on-disk OCI layout holding the blobs instead.
+type image struct {
+	Layers  []ocispec.Descriptor
+	Config  ocispec.ImageConfig
+	BlobDir string
+}
+
+// pullImage resolves and pulls ref using containerd's client when a
+// containerd daemon is reachable, otherwise falls back to the
+// containers/image library so a bare host without containerd installed
+// can still convert images.
+func pullImage(ctx context.Context, ref string) (*image, error) {
+	client, err := containerd.New(defaultSocket)
+	if err != nil {
+		return pullImageFallback(ctx, ref)
+	}
+	defer client.Close()
+
+	ctx = namespaces.WithNamespace(ctx, defaultNamespace)
+
+	img, err := client.Pull(ctx, ref, containerd.WithPullUnpack)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	manifest, err := images.Manifest(ctx, client.ContentStore(), img.Target(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	config, err := decodeImageConfig(ctx, client, img.Target())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &image{
+		Layers: manifest.Layers,
+		Config: config,
+	}, nil
+}
@@ -0,0 +1,111 @@
+package image2rootfs
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/containers/image/v5/copy"
+	ocilayout "github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/signature"
+	alltransports "github.com/containers/image/v5/transports/alltransports"
+)
+
+// decodeImageConfig reads and unmarshals the OCI image config blob
+// referenced by the manifest at target.
+func decodeImageConfig(ctx context.Context, client *containerd.Client, target ocispec.Descriptor) (ocispec.ImageConfig, error) {
+	manifest, err := images.Manifest(ctx, client.ContentStore(), target, nil)
+	if err != nil {
+		return ocispec.ImageConfig{}, errors.WithStack(err)
+	}
+
+	raw, err := content.ReadBlob(ctx, client.ContentStore(), manifest.Config)
+	if err != nil {
+		return ocispec.ImageConfig{}, errors.WithStack(err)
+	}
+
+	var spec ocispec.Image
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return ocispec.ImageConfig{}, errors.WithStack(err)
+	}
+	return spec.Config, nil
+}
+
+// pullImageFallback pulls ref using the containers/image library when no
+// containerd daemon is reachable on the host — the common case on a
+// plain macOS host, which is this project's actual target platform.
+// It copies the image into a temporary on-disk OCI layout (accepting
+// any signature policy, matching containerd's default of trusting
+// whatever the registry serves) and reads the manifest/config/layers
+// back out of that layout, the same shapes the containerd path
+// produces.
+func pullImageFallback(ctx context.Context, ref string) (*image, error) {
+	srcRef, err := alltransports.ParseImageName("docker://" + ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing image reference %q", ref)
+	}
+
+	layoutDir, err := os.MkdirTemp("", "m1-docker-pull-")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	destRef, err := ocilayout.ParseReference(layoutDir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	policyCtx, err := signature.NewPolicyContext(&signature.Policy{
+		Default: signature.PolicyRequirements{signature.NewPRInsecureAcceptAnything()},
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer policyCtx.Destroy()
+
+	if _, err := copy.Image(ctx, policyCtx, destRef, srcRef, nil); err != nil {
+		return nil, errors.Wrapf(err, "copying %s into OCI layout", ref)
+	}
+
+	manifest, config, err := readOCILayoutManifest(layoutDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &image{
+		Layers:  manifest.Layers,
+		Config:  config,
+		BlobDir: layoutDir,
+	}, nil
+}
+
+// readOCILayoutManifest reads index.json from an OCI layout directory,
+// follows its single entry to the image manifest, and decodes both the
+// manifest and the image config it points at.
+func readOCILayoutManifest(layoutDir string) (ocispec.Manifest, ocispec.ImageConfig, error) {
+	index, err := readLayoutBlob[ocispec.Index](indexPath(layoutDir))
+	if err != nil {
+		return ocispec.Manifest{}, ocispec.ImageConfig{}, errors.Wrap(err, "reading OCI layout index")
+	}
+	if len(index.Manifests) == 0 {
+		return ocispec.Manifest{}, ocispec.ImageConfig{}, errors.New("OCI layout index has no manifests")
+	}
+
+	manifest, err := readLayoutBlob[ocispec.Manifest](blobPath(layoutDir, index.Manifests[0]))
+	if err != nil {
+		return ocispec.Manifest{}, ocispec.ImageConfig{}, errors.Wrap(err, "reading OCI layout manifest")
+	}
+
+	spec, err := readLayoutBlob[ocispec.Image](blobPath(layoutDir, manifest.Config))
+	if err != nil {
+		return ocispec.Manifest{}, ocispec.ImageConfig{}, errors.Wrap(err, "reading OCI layout image config")
+	}
+
+	return manifest, spec.Config, nil
+}
@@ -0,0 +1,241 @@
+package image2rootfs
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// whiteoutPrefix marks a deleted file in an OCI layer: "foo" is deleted
+// by a sibling entry named ".wh.foo".
+const whiteoutPrefix = ".wh."
+
+// whiteoutOpaqueDir marks a directory whose pre-existing contents (from
+// earlier layers) must be hidden, though the directory itself stays.
+const whiteoutOpaqueDir = ".wh..wh..opq"
+
+// unpackLayers applies img's layers in order into dest, honoring
+// whiteouts so that a file deleted in a later layer doesn't reappear
+// from an earlier one. Layer bytes are read from img.BlobDir's OCI
+// layout when set (the containers/image fallback path), otherwise from
+// the local containerd content store.
+func unpackLayers(dest string, img *image) error {
+	if img.BlobDir != "" {
+		return unpackLayersFromLayout(dest, img.BlobDir, img.Layers)
+	}
+	return unpackLayersFromContainerd(dest, img.Layers)
+}
+
+func unpackLayersFromContainerd(dest string, layers []ocispec.Descriptor) error {
+	ctx := context.Background()
+	client, err := containerd.New(defaultSocket)
+	if err != nil {
+		return errors.Wrap(err, "containerd unavailable for layer unpack")
+	}
+	defer client.Close()
+
+	for _, layer := range layers {
+		ra, err := client.ContentStore().ReaderAt(ctx, layer)
+		if err != nil {
+			return errors.Wrapf(err, "reading layer %s", layer.Digest)
+		}
+		err = applyLayer(dest, content.NewReader(ra))
+		ra.Close()
+		if err != nil {
+			return errors.Wrapf(err, "applying layer %s", layer.Digest)
+		}
+	}
+	return nil
+}
+
+func unpackLayersFromLayout(dest, layoutDir string, layers []ocispec.Descriptor) error {
+	for _, layer := range layers {
+		f, err := readBlobFile(layoutDir, layer)
+		if err != nil {
+			return err
+		}
+		err = applyLayer(dest, f)
+		f.Close()
+		if err != nil {
+			return errors.Wrapf(err, "applying layer %s", layer.Digest)
+		}
+	}
+	return nil
+}
+
+// applyLayer extracts a single gzip-compressed tar layer into dest.
+func applyLayer(dest string, r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := applyTarEntry(dest, hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// safeJoin joins dest with the tar-relative path rel (which may come
+// from an attacker-controlled layer) and verifies the result doesn't
+// escape dest via "..", refusing entries like "../../etc/cron.d/evil"
+// (CWE-22 "tar-slip"). rel is always treated as relative to dest, even
+// if it looks absolute.
+func safeJoin(dest, rel string) (string, error) {
+	cleanDest := filepath.Clean(dest)
+	target := filepath.Join(cleanDest, rel)
+	if target != cleanDest && !strings.HasPrefix(target, cleanDest+string(filepath.Separator)) {
+		return "", errors.Errorf("path %q escapes %s", rel, dest)
+	}
+	return target, nil
+}
+
+func applyTarEntry(dest string, hdr *tar.Header, r io.Reader) error {
+	name := filepath.Clean(hdr.Name)
+	dir, base := filepath.Split(name)
+
+	if base == whiteoutOpaqueDir {
+		opaque, err := safeJoin(dest, dir)
+		if err != nil {
+			log.Println("image2rootfs: skipping opaque whiteout:", err)
+			return nil
+		}
+		if err := clearDirContents(opaque); err != nil {
+			return errors.Wrapf(err, "applying opaque whiteout for %s", dir)
+		}
+		return nil
+	}
+
+	if strings.HasPrefix(base, whiteoutPrefix) {
+		target, err := safeJoin(dest, filepath.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+		if err != nil {
+			log.Println("image2rootfs: skipping whiteout:", err)
+			return nil
+		}
+		if err := os.RemoveAll(target); err != nil {
+			return errors.Wrapf(err, "applying whiteout for %s", target)
+		}
+		return nil
+	}
+
+	target, err := safeJoin(dest, name)
+	if err != nil {
+		log.Println("image2rootfs: skipping tar entry:", err)
+		return nil
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(target, tarFileMode(hdr.Mode)); err != nil {
+			return errors.WithStack(err)
+		}
+	case tar.TypeReg:
+		if err := ensureDir(filepath.Dir(target)); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, tarFileMode(hdr.Mode))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = io.Copy(f, r)
+		f.Close()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	case tar.TypeSymlink:
+		// hdr.Linkname is the symlink's literal content, not itself a
+		// host path to join. A relative target is resolved from the
+		// link's own directory and refused when it climbs out of dest
+		// via ".."; an absolute target (e.g. "/etc/passwd") is taken
+		// as rooted at dest, the same way safeJoin treats any path,
+		// so it is kept.
+		linkTarget := hdr.Linkname
+		if !filepath.IsAbs(linkTarget) {
+			linkTarget = filepath.Join(dir, linkTarget)
+		}
+		if _, err := safeJoin(dest, linkTarget); err != nil {
+			log.Println("image2rootfs: skipping symlink with unsafe target:", err)
+			return nil
+		}
+		if err := ensureDir(filepath.Dir(target)); err != nil {
+			return err
+		}
+		os.Remove(target)
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return errors.WithStack(err)
+		}
+	case tar.TypeLink:
+		oldname, err := safeJoin(dest, hdr.Linkname)
+		if err != nil {
+			log.Println("image2rootfs: skipping hardlink with unsafe target:", err)
+			return nil
+		}
+		if err := ensureDir(filepath.Dir(target)); err != nil {
+			return err
+		}
+		os.Remove(target)
+		if err := os.Link(oldname, target); err != nil {
+			return errors.WithStack(err)
+		}
+	default:
+		// Device nodes, fifos, etc. are skipped: the synthesized VM
+		// rootfs doesn't need them and creating them requires root.
+	}
+	return nil
+}
+
+// tarFileMode translates a tar header's raw mode bits (hdr.Mode) into an
+// os.FileMode. os.FileMode's syscallMode only recognizes setuid/setgid/
+// sticky via the symbolic os.ModeSetuid/ModeSetgid/ModeSticky bits, not
+// the raw 04000/02000/01000 bits tar headers carry, so passing hdr.Mode
+// straight through to os.OpenFile/os.MkdirAll silently drops those bits
+// (e.g. every setuid binary in the unpacked image loses its setuid bit).
+func tarFileMode(mode int64) os.FileMode {
+	fm := os.FileMode(mode) & os.ModePerm
+	if mode&0o4000 != 0 {
+		fm |= os.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		fm |= os.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		fm |= os.ModeSticky
+	}
+	return fm
+}
+
+func clearDirContents(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
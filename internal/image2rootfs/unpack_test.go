@@ -0,0 +1,181 @@
+package image2rootfs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSafeJoin(t *testing.T) {
+	dest := "/staging"
+	tests := []struct {
+		name    string
+		rel     string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain file", rel: "etc/hostname", want: "/staging/etc/hostname"},
+		{name: "absolute path is relative to dest", rel: "/etc/hostname", want: "/staging/etc/hostname"},
+		{name: "dest itself", rel: ".", want: "/staging"},
+		{name: "simple traversal", rel: "../etc/passwd", wantErr: true},
+		{name: "deep traversal", rel: "../../../../etc/passwd", wantErr: true},
+		{name: "traversal disguised mid-path", rel: "var/../../etc/passwd", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := safeJoin(dest, tt.rel)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("safeJoin(%q, %q) = %q, want error", dest, tt.rel, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("safeJoin(%q, %q) unexpected error: %v", dest, tt.rel, err)
+			}
+			if got != tt.want {
+				t.Errorf("safeJoin(%q, %q) = %q, want %q", dest, tt.rel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyLayerRejectsTarSlip(t *testing.T) {
+	dest := t.TempDir()
+
+	layer := buildGzippedTar(t, []tarEntry{
+		{name: "etc/hostname", typeflag: tar.TypeReg, content: "ok\n"},
+		{name: "../../../../tmp/evil", typeflag: tar.TypeReg, content: "pwned\n"},
+		{name: "evil-symlink", typeflag: tar.TypeSymlink, linkname: "../../../../etc/passwd"},
+	})
+
+	if err := applyLayer(dest, bytes.NewReader(layer)); err != nil {
+		t.Fatalf("applyLayer: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dest, "etc", "hostname")); err != nil {
+		t.Errorf("expected etc/hostname to be extracted: %v", err)
+	}
+	if _, err := os.Lstat("/tmp/evil"); err == nil {
+		t.Errorf("tar-slip entry escaped dest to /tmp/evil")
+		os.Remove("/tmp/evil")
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "evil-symlink")); err == nil {
+		t.Errorf("symlink with unsafe target should have been skipped")
+	}
+}
+
+func TestApplyLayerWhiteouts(t *testing.T) {
+	dest := t.TempDir()
+
+	base := buildGzippedTar(t, []tarEntry{
+		{name: "var/cache/a", typeflag: tar.TypeReg, content: "a"},
+		{name: "var/cache/b", typeflag: tar.TypeReg, content: "b"},
+	})
+	if err := applyLayer(dest, bytes.NewReader(base)); err != nil {
+		t.Fatalf("applyLayer(base): %v", err)
+	}
+
+	overlay := buildGzippedTar(t, []tarEntry{
+		{name: "var/cache/.wh.a", typeflag: tar.TypeReg, content: ""},
+	})
+	if err := applyLayer(dest, bytes.NewReader(overlay)); err != nil {
+		t.Fatalf("applyLayer(overlay): %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dest, "var", "cache", "a")); !os.IsNotExist(err) {
+		t.Errorf("whiteout should have removed var/cache/a, stat err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "var", "cache", "b")); err != nil {
+		t.Errorf("var/cache/b should survive the whiteout: %v", err)
+	}
+}
+
+func TestTarFileMode(t *testing.T) {
+	tests := []struct {
+		name string
+		mode int64
+		want os.FileMode
+	}{
+		{name: "plain file", mode: 0o644, want: 0o644},
+		{name: "setuid", mode: 0o4755, want: 0o755 | os.ModeSetuid},
+		{name: "setgid", mode: 0o2755, want: 0o755 | os.ModeSetgid},
+		{name: "sticky", mode: 0o1777, want: 0o777 | os.ModeSticky},
+		{name: "setuid+setgid+sticky", mode: 0o7755, want: 0o755 | os.ModeSetuid | os.ModeSetgid | os.ModeSticky},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tarFileMode(tt.mode); got != tt.want {
+				t.Errorf("tarFileMode(%#o) = %#o, want %#o", tt.mode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyLayerPreservesSetuidBit(t *testing.T) {
+	dest := t.TempDir()
+
+	layer := buildGzippedTar(t, []tarEntry{
+		{name: "usr/bin/sudo", typeflag: tar.TypeReg, content: "binary", mode: 0o4755},
+	})
+	if err := applyLayer(dest, bytes.NewReader(layer)); err != nil {
+		t.Fatalf("applyLayer: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dest, "usr", "bin", "sudo"))
+	if err != nil {
+		t.Fatalf("stat extracted file: %v", err)
+	}
+	if info.Mode()&os.ModeSetuid == 0 {
+		t.Errorf("extracted file mode %v is missing the setuid bit", info.Mode())
+	}
+}
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	content  string
+	linkname string
+	mode     int64 // defaults to 0o644 when zero
+}
+
+func buildGzippedTar(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	for _, e := range entries {
+		mode := e.mode
+		if mode == 0 {
+			mode = 0o644
+		}
+		hdr := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Mode:     mode,
+			Size:     int64(len(e.content)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("WriteHeader(%s): %v", e.name, err)
+		}
+		if e.content != "" {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatalf("Write(%s): %v", e.name, err)
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar Close: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip Close: %v", err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,284 @@
+// Package machine manages the on-disk state of named VMs, modelled on
+// how `podman machine` lays out its own machines directory: each VM
+// gets its own directory under ~/.m1-docker/machines/<name>/ holding
+// its kernel, initrd, rootfs image, cloud-init seed, config, pidfile,
+// and console log.
+package machine
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Config describes a named VM: its resources and how it was created.
+// It's persisted as config.json in the machine's directory so `start`,
+// `stop`, and `ssh` don't need to be told the image/cpus/memory again.
+type Config struct {
+	Name              string   `json:"name"`
+	Image             string   `json:"image,omitempty"`
+	CPUs              int      `json:"cpus"`
+	MemoryMB          int      `json:"memory_mb"`
+	DiskMB            int      `json:"disk_mb"`
+	CommandLine       string   `json:"command_line"`
+	Hostname          string   `json:"hostname"`
+	User              string   `json:"user"`
+	Password          string   `json:"password,omitempty"`
+	SSHAuthorizedKeys []string `json:"ssh_authorized_keys,omitempty"`
+	RunCmd            []string `json:"run_cmd,omitempty"`
+	DockerVsockPort   uint32   `json:"docker_vsock_port"`
+	MAC               string   `json:"mac,omitempty"`
+}
+
+// BaseDir returns ~/.m1-docker/machines, creating it if necessary.
+func BaseDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	dir := filepath.Join(home, ".m1-docker", "machines")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return dir, nil
+}
+
+// Dir returns the directory for the named machine, creating it if
+// necessary.
+func Dir(name string) (string, error) {
+	base, err := BaseDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return dir, nil
+}
+
+func path(name string, elem string) (string, error) {
+	dir, err := Dir(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, elem), nil
+}
+
+// ConfigPath, KernelPath, InitrdPath, DiskImgPath, SeedImgPath, PidPath,
+// and LogPath return the well-known files inside a machine's directory.
+func ConfigPath(name string) (string, error)       { return path(name, "config.json") }
+func KernelPath(name string) (string, error)       { return path(name, "vmlinuz") }
+func InitrdPath(name string) (string, error)       { return path(name, "initrd") }
+func DiskImgPath(name string) (string, error)      { return path(name, "disk.img") }
+func SeedImgPath(name string) (string, error)      { return path(name, "seed.iso") }
+func PidPath(name string) (string, error)          { return path(name, "pid") }
+func LogPath(name string) (string, error)          { return path(name, "console.log") }
+func DockerSocketPath(name string) (string, error) { return path(name, "docker.sock") }
+func SSHPortPath(name string) (string, error)      { return path(name, "ssh.port") }
+
+// SnapshotDir returns the directory for a named snapshot of a machine,
+// creating it if necessary: ~/.m1-docker/machines/<name>/snapshots/<snapshot>.
+func SnapshotDir(name, snapshot string) (string, error) {
+	dir, err := Dir(name)
+	if err != nil {
+		return "", err
+	}
+	snapDir := filepath.Join(dir, "snapshots", snapshot)
+	if err := os.MkdirAll(snapDir, 0o755); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return snapDir, nil
+}
+
+func snapshotPath(name, snapshot, elem string) (string, error) {
+	dir, err := SnapshotDir(name, snapshot)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, elem), nil
+}
+
+// SnapshotDiskPath and SnapshotConfigPath return the well-known files
+// inside a snapshot's directory.
+func SnapshotDiskPath(name, snapshot string) (string, error) {
+	return snapshotPath(name, snapshot, "disk.img")
+}
+func SnapshotConfigPath(name, snapshot string) (string, error) {
+	return snapshotPath(name, snapshot, "config.json")
+}
+
+// ListSnapshots returns the names of a machine's snapshots.
+func ListSnapshots(name string) ([]string, error) {
+	dir, err := Dir(name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "snapshots"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// RemoveSnapshot deletes a named snapshot's directory.
+func RemoveSnapshot(name, snapshot string) error {
+	dir, err := SnapshotDir(name, snapshot)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Load reads the config.json of the named machine.
+func Load(name string) (*Config, error) {
+	p, err := ConfigPath(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("machine %q does not exist", name)
+		}
+		return nil, errors.WithStack(err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, errors.Wrapf(err, "parsing config for machine %q", name)
+	}
+	return &cfg, nil
+}
+
+// Save writes cfg to its machine's config.json.
+func Save(cfg *Config) error {
+	p, err := ConfigPath(cfg.Name)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.WriteFile(p, data, 0o644); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Exists reports whether a machine with the given name has been
+// initialized.
+func Exists(name string) (bool, error) {
+	p, err := ConfigPath(name)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(p); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.WithStack(err)
+	}
+	return true, nil
+}
+
+// List returns the names of all initialized machines.
+func List() ([]string, error) {
+	base, err := BaseDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		ok, err := Exists(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// Remove deletes the named machine's entire directory.
+func Remove(name string) error {
+	dir, err := Dir(name)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// ReadPid reads the pidfile written by `start`, returning 0 if there is
+// no pidfile. A pidfile left behind by a process that has since exited
+// still yields its pid, so callers check the process is alive.
+func ReadPid(name string) (int, error) {
+	p, err := PidPath(name)
+	if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, errors.WithStack(err)
+	}
+	pid, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, errors.Wrapf(err, "parsing pidfile for machine %q", name)
+	}
+	return pid, nil
+}
+
+// WritePid records the pid of the daemonized `start` process.
+func WritePid(name string, pid int) error {
+	p, err := PidPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(p, []byte(strconv.Itoa(pid)), 0o644); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// RemovePid clears the pidfile, e.g. after `stop`.
+func RemovePid(name string) error {
+	p, err := PidPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
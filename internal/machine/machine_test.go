@@ -0,0 +1,133 @@
+package machine
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func withTempHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	return home
+}
+
+func TestPathHelpers(t *testing.T) {
+	home := withTempHome(t)
+	want := filepath.Join(home, ".m1-docker", "machines", "web-1", "vmlinuz")
+
+	got, err := KernelPath("web-1")
+	if err != nil {
+		t.Fatalf("KernelPath: %v", err)
+	}
+	if got != want {
+		t.Errorf("KernelPath(%q) = %q, want %q", "web-1", got, want)
+	}
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	withTempHome(t)
+
+	cfg := &Config{
+		Name:     "web-1",
+		CPUs:     2,
+		MemoryMB: 2048,
+	}
+	if err := Save(cfg); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	exists, err := Exists("web-1")
+	if err != nil {
+		t.Fatalf("Exists: %v", err)
+	}
+	if !exists {
+		t.Fatal("Exists(web-1) = false after Save")
+	}
+
+	got, err := Load("web-1")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(*got, *cfg) {
+		t.Errorf("Load() = %+v, want %+v", *got, *cfg)
+	}
+}
+
+func TestLoadMissingMachine(t *testing.T) {
+	withTempHome(t)
+
+	if _, err := Load("does-not-exist"); err == nil {
+		t.Fatal("Load of a nonexistent machine should error")
+	}
+}
+
+func TestPidRoundTrip(t *testing.T) {
+	withTempHome(t)
+
+	pid, err := ReadPid("web-1")
+	if err != nil {
+		t.Fatalf("ReadPid before WritePid: %v", err)
+	}
+	if pid != 0 {
+		t.Fatalf("ReadPid before WritePid = %d, want 0", pid)
+	}
+
+	if err := WritePid("web-1", 4242); err != nil {
+		t.Fatalf("WritePid: %v", err)
+	}
+	pid, err = ReadPid("web-1")
+	if err != nil {
+		t.Fatalf("ReadPid: %v", err)
+	}
+	if pid != 4242 {
+		t.Fatalf("ReadPid = %d, want 4242", pid)
+	}
+
+	if err := RemovePid("web-1"); err != nil {
+		t.Fatalf("RemovePid: %v", err)
+	}
+	pid, err = ReadPid("web-1")
+	if err != nil {
+		t.Fatalf("ReadPid after RemovePid: %v", err)
+	}
+	if pid != 0 {
+		t.Fatalf("ReadPid after RemovePid = %d, want 0", pid)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	withTempHome(t)
+
+	names, err := ListSnapshots("web-1")
+	if err != nil {
+		t.Fatalf("ListSnapshots on a machine with none: %v", err)
+	}
+	if len(names) != 0 {
+		t.Fatalf("ListSnapshots = %v, want empty", names)
+	}
+
+	if _, err := SnapshotDir("web-1", "before-upgrade"); err != nil {
+		t.Fatalf("SnapshotDir: %v", err)
+	}
+
+	names, err = ListSnapshots("web-1")
+	if err != nil {
+		t.Fatalf("ListSnapshots: %v", err)
+	}
+	if len(names) != 1 || names[0] != "before-upgrade" {
+		t.Fatalf("ListSnapshots = %v, want [before-upgrade]", names)
+	}
+
+	if err := RemoveSnapshot("web-1", "before-upgrade"); err != nil {
+		t.Fatalf("RemoveSnapshot: %v", err)
+	}
+	names, err = ListSnapshots("web-1")
+	if err != nil {
+		t.Fatalf("ListSnapshots after remove: %v", err)
+	}
+	if len(names) != 0 {
+		t.Fatalf("ListSnapshots after remove = %v, want empty", names)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !darwin
+
+package snapshot
+
+import (
+	"io"
+	"os"
+)
+
+// cloneFile is a plain byte-for-byte copy on non-APFS hosts. m1-docker
+// itself only targets macOS, but this keeps the package buildable on
+// any dev machine.
+func cloneFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
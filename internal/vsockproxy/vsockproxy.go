@@ -0,0 +1,150 @@
+// Package vsockproxy forwards a host-side listener to a single port on
+// the guest's virtio-vsock device. It's deliberately protocol-agnostic:
+// it just copies bytes in both directions, which is enough to carry
+// anything from a Docker API (including hijacked attach/exec/build
+// streams) to a plain SSH session, as long as the guest is listening on
+// the given vsock port.
+package vsockproxy
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/Code-Hex/vz"
+	"github.com/pkg/errors"
+)
+
+// Proxy forwards host connections to a fixed port on the guest's vsock
+// device, reconnecting to the guest as needed.
+type Proxy struct {
+	device *vz.VirtioSocketDevice
+	port   uint32
+}
+
+// New returns a Proxy that forwards to port on device, which must be
+// the VirtioSocketDevice of an already-started VM.
+func New(device *vz.VirtioSocketDevice, port uint32) *Proxy {
+	return &Proxy{device: device, port: port}
+}
+
+// ListenUnix listens on a unix socket at socketPath and proxies every
+// accepted connection to the guest vsock port until ctx is canceled.
+func (p *Proxy) ListenUnix(ctx context.Context, socketPath string) error {
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return errors.Wrapf(err, "listening on %s", socketPath)
+	}
+	return p.serve(ctx, ln)
+}
+
+// ListenTCP binds addr (host:port, port 0 for an OS-assigned port) and
+// returns the bound listener immediately, serving accepted connections
+// in the background until ctx is canceled. This is how per-service
+// forwards like SSH get a port to hand to a client without blocking the
+// caller on the whole proxy lifetime.
+func (p *Proxy) ListenTCP(ctx context.Context, addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "listening on %s", addr)
+	}
+	go func() {
+		if err := p.serve(ctx, ln); err != nil {
+			log.Println("vsockproxy: serve:", err)
+		}
+	}()
+	return ln, nil
+}
+
+func (p *Proxy) serve(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+				return errors.WithStack(err)
+			}
+		}
+		go p.handle(ctx, conn)
+	}
+}
+
+// handle proxies a single host connection to the guest, retrying the
+// vsock dial a few times so a connection made right after a guest
+// restart doesn't just fail outright.
+func (p *Proxy) handle(ctx context.Context, hostConn net.Conn) {
+	defer hostConn.Close()
+
+	guestConn, err := p.dialWithRetry(ctx)
+	if err != nil {
+		log.Println("vsockproxy: dial guest:", err)
+		return
+	}
+	defer guestConn.Close()
+
+	proxyPair(hostConn, guestConn)
+}
+
+func (p *Proxy) dialWithRetry(ctx context.Context) (net.Conn, error) {
+	const (
+		attempts = 5
+		backoff  = 200 * time.Millisecond
+	)
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		conn, err := p.device.ConnectToPort(p.port)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+	return nil, errors.Wrapf(lastErr, "connecting to guest vsock port %d after %d attempts", p.port, attempts)
+}
+
+// proxyPair copies in both directions, closing the write-half of each
+// side as soon as the other's read-half is exhausted so a half-close
+// (e.g. a client that finishes sending a build context but still wants
+// the response) propagates correctly instead of wedging the connection.
+func proxyPair(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+
+	go func() {
+		io.Copy(a, b)
+		closeWrite(a)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		closeWrite(b)
+		done <- struct{}{}
+	}()
+
+	<-done
+	<-done
+}
+
+type writeCloser interface {
+	CloseWrite() error
+}
+
+func closeWrite(conn net.Conn) {
+	if wc, ok := conn.(writeCloser); ok {
+		wc.CloseWrite()
+		return
+	}
+	conn.Close()
+}
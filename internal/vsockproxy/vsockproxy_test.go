@@ -0,0 +1,119 @@
+package vsockproxy
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// tcpPipe returns a connected pair of TCP connections, used in place of
+// net.Pipe() because proxyPair/closeWrite rely on CloseWrite, which
+// net.Pipe's in-memory net.Conn doesn't implement.
+func tcpPipe(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	acceptCh := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			acceptCh <- nil
+			return
+		}
+		acceptCh <- conn
+	}()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	server := <-acceptCh
+	if server == nil {
+		t.Fatal("accept failed")
+	}
+	return client, server
+}
+
+func TestProxyPairForwardsBothDirections(t *testing.T) {
+	host, hostPeer := tcpPipe(t)
+	defer hostPeer.Close()
+	guest, guestPeer := tcpPipe(t)
+	defer guestPeer.Close()
+
+	done := make(chan struct{})
+	go func() {
+		proxyPair(host, guest)
+		close(done)
+	}()
+
+	if _, err := hostPeer.Write([]byte("ping")); err != nil {
+		t.Fatalf("write host->guest: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(guestPeer, buf); err != nil {
+		t.Fatalf("read on guest side: %v", err)
+	}
+	if string(buf) != "ping" {
+		t.Errorf("guest side got %q, want %q", buf, "ping")
+	}
+
+	if _, err := guestPeer.Write([]byte("pong")); err != nil {
+		t.Fatalf("write guest->host: %v", err)
+	}
+	if _, err := io.ReadFull(hostPeer, buf); err != nil {
+		t.Fatalf("read on host side: %v", err)
+	}
+	if string(buf) != "pong" {
+		t.Errorf("host side got %q, want %q", buf, "pong")
+	}
+
+	hostPeer.Close()
+	guestPeer.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("proxyPair did not return after both peers closed")
+	}
+}
+
+func TestProxyPairPropagatesHalfClose(t *testing.T) {
+	host, hostPeer := tcpPipe(t)
+	defer host.Close()
+	defer hostPeer.Close()
+	guest, guestPeer := tcpPipe(t)
+	defer guest.Close()
+	defer guestPeer.Close()
+
+	go proxyPair(host, guest)
+
+	// hostPeer finishes sending but still wants to read the response
+	// (e.g. a client that closed its write side after a build context).
+	if err := hostPeer.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatalf("CloseWrite: %v", err)
+	}
+
+	// The half-close must propagate through proxyPair to guestPeer.
+	buf := make([]byte, 1)
+	n, err := guestPeer.Read(buf)
+	if n != 0 || err != io.EOF {
+		t.Fatalf("guestPeer.Read() = (%d, %v), want (0, io.EOF)", n, err)
+	}
+
+	// The connection isn't fully torn down: a response can still flow.
+	if _, err := guestPeer.Write([]byte("ok")); err != nil {
+		t.Fatalf("write guest->host after half-close: %v", err)
+	}
+	out := make([]byte, 2)
+	if _, err := io.ReadFull(hostPeer, out); err != nil {
+		t.Fatalf("read response on host side: %v", err)
+	}
+	if string(out) != "ok" {
+		t.Errorf("host side got %q, want %q", out, "ok")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	archiver "github.com/mholt/archiver/v3"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultVmlinuzURL = "https://cloud-images.ubuntu.com/releases/focal/release/unpacked/ubuntu-20.04-server-cloudimg-arm64-vmlinuz-generic"
+	defaultInitrdURL  = "https://cloud-images.ubuntu.com/releases/focal/release/unpacked/ubuntu-20.04-server-cloudimg-arm64-initrd-generic"
+	defaultDiskImgURL = "https://cloud-images.ubuntu.com/releases/focal/release/ubuntu-20.04-server-cloudimg-arm64.tar.gz"
+	// defaultDiskImgMember is the disk image's file name inside the
+	// defaultDiskImgURL tarball.
+	defaultDiskImgMember = "focal-server-cloudimg-arm64.img"
+)
+
+// fetchDefaultVmlinuz downloads and unpacks the project's default
+// Ubuntu vmlinuz to dest, for machines that weren't given -image or
+// whose image doesn't ship its own kernel.
+func fetchDefaultVmlinuz(ctx context.Context, dest string) error {
+	tmp := dest + ".gz"
+	if err := downloadFile(ctx, defaultVmlinuzURL, tmp); err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmp)
+	if err := unarchiveGZip(tmp, dest); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// fetchDefaultInitrd downloads the project's default Ubuntu initrd to
+// dest.
+func fetchDefaultInitrd(ctx context.Context, dest string) error {
+	if err := downloadFile(ctx, defaultInitrdURL, dest); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// fetchDefaultDiskImg downloads and extracts the project's default
+// Ubuntu cloud image to dest, then grows it to sizeMB.
+func fetchDefaultDiskImg(ctx context.Context, dest string, sizeMB int) error {
+	dir := filepath.Dir(dest)
+	archiveName := filepath.Join(dir, filepath.Base(defaultDiskImgURL))
+	if err := downloadFile(ctx, defaultDiskImgURL, archiveName); err != nil {
+		return errors.WithStack(err)
+	}
+
+	gz := archiver.NewTarGz()
+	// extracted as <dest>/<defaultDiskImgMember>, see the rename dance below.
+	if err := gz.Extract(archiveName, defaultDiskImgMember, dest); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.Remove(archiveName); err != nil {
+		return errors.WithStack(err)
+	}
+
+	scratch := filepath.Join(dir, "folder")
+	if err := os.Rename(dest, scratch); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.Rename(filepath.Join(scratch, defaultDiskImgMember), dest); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.Remove(scratch); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return extendDiskImg(dest, sizeMB)
+}
+
+// extendDiskImg grows a raw disk image to sizeMB megabytes in place.
+func extendDiskImg(name string, sizeMB int) error {
+	cmd := exec.Command(
+		"dd",
+		"if=/dev/zero",
+		fmt.Sprintf("of=%s", name),
+		fmt.Sprintf("seek=%d", sizeMB),
+		"bs=1024k",
+		"count=0",
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "dd: %s", out)
+	}
+	return nil
+}
+
+func downloadFile(ctx context.Context, url string, destPath string) error {
+	f, err := os.Create(destPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// copyFile copies src to dest, used to promote a kernel/initrd found
+// inside a converted image's rootfs into the machine directory proper.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func unarchiveGZip(src string, dest string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	df, err := os.Create(dest)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer df.Close()
+
+	gz := archiver.NewGz()
+	if err := gz.Decompress(f, df); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
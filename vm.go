@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/Code-Hex/m1-docker/internal/machine"
+	"github.com/Code-Hex/m1-docker/internal/vsockproxy"
+	"github.com/Code-Hex/vz"
+	"github.com/kr/pty"
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+)
+
+// runVM boots cfg's machine in the foreground: it attaches the
+// console (to the current tty when one is attached, or straight to
+// stdout/stdin when running headless under daemonize), wires up
+// networking, storage, entropy, and vsock devices, starts the VM,
+// forwards its Docker API over vsock, and blocks until the VM stops or
+// ctx is canceled.
+func runVM(ctx context.Context, cfg *machine.Config) error {
+	kernelPath, err := machine.KernelPath(cfg.Name)
+	if err != nil {
+		return err
+	}
+	initrdPath, err := machine.InitrdPath(cfg.Name)
+	if err != nil {
+		return err
+	}
+	diskImgPath, err := machine.DiskImgPath(cfg.Name)
+	if err != nil {
+		return err
+	}
+	seedImgPath, err := machine.SeedImgPath(cfg.Name)
+	if err != nil {
+		return err
+	}
+
+	bootLoader := vz.NewLinuxBootLoader(
+		kernelPath,
+		vz.WithCommandLine(cfg.CommandLine),
+		vz.WithInitrd(initrdPath),
+	)
+
+	config := vz.NewVirtualMachineConfiguration(
+		bootLoader,
+		uint(cfg.CPUs),
+		uint64(cfg.MemoryMB)*1024*1024,
+	)
+
+	consoleConfig, closeConsole, err := setupConsole()
+	if err != nil {
+		return err
+	}
+	defer closeConsole()
+
+	config.SetSerialPortsVirtualMachineConfiguration([]*vz.VirtioConsoleDeviceSerialPortConfiguration{
+		consoleConfig,
+	})
+
+	// network
+	natAttachment := vz.NewNATNetworkDeviceAttachment()
+	networkConfig := vz.NewVirtioNetworkDeviceConfiguration(natAttachment)
+	config.SetNetworkDevicesVirtualMachineConfiguration([]*vz.VirtioNetworkDeviceConfiguration{
+		networkConfig,
+	})
+
+	// entropy
+	entropyConfig := vz.NewVirtioEntropyDeviceConfiguration()
+	config.SetEntropyDevicesVirtualMachineConfiguration([]*vz.VirtioEntropyDeviceConfiguration{
+		entropyConfig,
+	})
+
+	diskImageAttachment, err := vz.NewDiskImageStorageDeviceAttachment(diskImgPath, false)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	seedAttachment, err := vz.NewDiskImageStorageDeviceAttachment(seedImgPath, true)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	config.SetStorageDevicesVirtualMachineConfiguration([]vz.StorageDeviceConfiguration{
+		vz.NewVirtioBlockDeviceConfiguration(diskImageAttachment),
+		vz.NewVirtioBlockDeviceConfiguration(seedAttachment),
+	})
+
+	// traditional memory balloon device which allows for managing guest memory. (optional)
+	config.SetMemoryBalloonDevicesVirtualMachineConfiguration([]vz.MemoryBalloonDeviceConfiguration{
+		vz.NewVirtioTraditionalMemoryBalloonDeviceConfiguration(),
+	})
+
+	// socket device (optional)
+	config.SetSocketDevicesVirtualMachineConfiguration([]vz.SocketDeviceConfiguration{
+		vz.NewVirtioSocketDeviceConfiguration(),
+	})
+
+	if _, err := config.Validate(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	vm := vz.NewVirtualMachine(config)
+
+	sig := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sig, os.Interrupt)
+
+	go func(vm *vz.VirtualMachine) {
+		for {
+			select {
+			case <-ctx.Done():
+				stopped, err := vm.RequestStop()
+				if err != nil {
+					close(done)
+					log.Fatal("RequestStop:", err)
+				}
+				log.Println("stopped:", stopped)
+				close(done)
+			case <-sig:
+				stopped, err := vm.RequestStop()
+				if err != nil {
+					close(done)
+					log.Fatal("RequestStop:", err)
+				}
+				log.Println("stopped:", stopped)
+				close(done)
+			case newState := <-vm.StateChangedNotify():
+				if newState == vz.VirtualMachineStateStopped {
+					close(done)
+				}
+				log.Println(
+					"newState:", newState,
+					"state:", vm.State(),
+					"canStart:", vm.CanStart(),
+					"canResume:", vm.CanResume(),
+					"canPause:", vm.CanPause(),
+					"canStopRequest:", vm.CanRequestStop(),
+				)
+			}
+		}
+	}(vm)
+
+	vm.Start(func(err error) {
+		log.Println("in start:", err)
+	})
+
+	dockerSocket, err := machine.DockerSocketPath(cfg.Name)
+	if err != nil {
+		return err
+	}
+	if err := startDockerProxy(ctx, vm, dockerSocket, cfg.DockerVsockPort); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := startSSHProxy(ctx, vm, cfg.Name); err != nil {
+		return errors.WithStack(err)
+	}
+
+	<-done
+	return nil
+}
+
+// setupConsole builds the VM's serial port attachment, wiring it to the
+// current tty (with raw mode and terminal resizing) when stdin is a
+// real terminal, or straight to stdin/stdout when it isn't. The latter
+// is the daemonize case: cmd_start.go's forked child has its stdin
+// redirected to /dev/null and stdout redirected to console.log, neither
+// of which is a tty, so term.MakeRaw/term.GetSize would fail with
+// ENOTTY before the VM ever boots.
+func setupConsole() (*vz.VirtioConsoleDeviceSerialPortConfiguration, func(), error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		attachment := vz.NewFileHandleSerialPortAttachment(os.Stdin, os.Stdout)
+		return vz.NewVirtioConsoleDeviceSerialPortConfiguration(attachment), func() {}, nil
+	}
+
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	inFd := int(os.Stdin.Fd())
+	oldInState, err := term.MakeRaw(inFd)
+	if err != nil {
+		ptmx.Close()
+		tty.Close()
+		return nil, nil, errors.WithStack(err)
+	}
+
+	if err := pty.InheritSize(os.Stdout, ptmx); err != nil {
+		term.Restore(inFd, oldInState)
+		ptmx.Close()
+		tty.Close()
+		return nil, nil, errors.Wrap(err, "resizing ptmx")
+	}
+
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		term.Restore(inFd, oldInState)
+		ptmx.Close()
+		tty.Close()
+		return nil, nil, errors.WithStack(err)
+	}
+
+	t := term.NewTerminal(os.Stdout, "")
+	if err := t.SetSize(width, height); err != nil {
+		term.Restore(inFd, oldInState)
+		ptmx.Close()
+		tty.Close()
+		return nil, nil, errors.WithStack(err)
+	}
+	go func() {
+		for {
+			_, err := io.Copy(t, ptmx)
+			if err != nil {
+				if unixIsEAGAIN(err) {
+					continue
+				}
+				log.Println("pty stdout err", err)
+			}
+			break
+		}
+	}()
+
+	attachment := vz.NewFileHandleSerialPortAttachment(os.Stdin, tty)
+	cleanup := func() {
+		term.Restore(inFd, oldInState)
+		ptmx.Close()
+		tty.Close()
+	}
+	return vz.NewVirtioConsoleDeviceSerialPortConfiguration(attachment), cleanup, nil
+}
+
+// guestSSHVsockPort is the vsock port the guest's sshd is expected to
+// listen on; the guest-side wiring for that is outside this repo's
+// scope, but the host side is ready for it.
+const guestSSHVsockPort = 22
+
+// startSSHProxy forwards an OS-assigned localhost TCP port to the
+// guest's sshd over vsock, recording the chosen port in ssh.port so
+// `m1-docker ssh <name>` can find it.
+func startSSHProxy(ctx context.Context, vm *vz.VirtualMachine, name string) error {
+	devices := vm.SocketDevices()
+	if len(devices) == 0 {
+		return errors.New("no virtio-vsock device configured on the VM")
+	}
+
+	proxy := vsockproxy.New(devices[0], guestSSHVsockPort)
+	ln, err := proxy.ListenTCP(ctx, "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	portPath, err := machine.SSHPortPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(portPath, []byte(strconv.Itoa(port)), 0o644); err != nil {
+		return errors.WithStack(err)
+	}
+
+	log.Println("ssh proxy listening on 127.0.0.1:", port)
+	return nil
+}
+
+// startDockerProxy forwards dockerSocket on the host to the guest's
+// dockerd listening on vsock port port, so `DOCKER_HOST=unix://<path>
+// docker ps` talks straight through to the VM.
+func startDockerProxy(ctx context.Context, vm *vz.VirtualMachine, dockerSocket string, port uint32) error {
+	devices := vm.SocketDevices()
+	if len(devices) == 0 {
+		return errors.New("no virtio-vsock device configured on the VM")
+	}
+	if err := os.Remove(dockerSocket); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	proxy := vsockproxy.New(devices[0], port)
+	go func() {
+		log.Println("docker API proxy listening on", dockerSocket)
+		if err := proxy.ListenUnix(ctx, dockerSocket); err != nil {
+			log.Println("docker API proxy stopped:", err)
+		}
+	}()
+	return nil
+}
+
+// unixIsEAGAIN reports whether err is a syscall.EAGAIN wrapped in a PathError.
+// See golang.org/issue/9205
+func unixIsEAGAIN(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		if errno, ok := pe.Err.(syscall.Errno); ok && errno == syscall.EAGAIN {
+			return true
+		}
+	}
+	return false
+}